@@ -1,7 +1,10 @@
 package iscsi
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
@@ -12,20 +15,127 @@ import (
 	"time"
 
 	"github.com/mitchellh/mapstructure"
+	"golang.org/x/sys/unix"
 )
 
 // IscsiConnectorInfo define
 type IscsiConnectorInfo struct {
-	AccessMode string `mapstructure:"accessMode"`
-	AuthUser   string `mapstructure:"authUserName"`
-	AuthPass   string `mapstructure:"authPassword"`
-	AuthMethod string `mapstructure:"authMethod"`
-	TgtDisco   bool   `mapstructure:"targetDiscovered"`
-	TgtIQN     string `mapstructure:"targetIqn"`
-	TgtPortal  string `mapstructure:"targetPortal"`
-	VolumeID   string `mapstructure:"volumeId"`
-	TgtLun     int    `mapstructure:"targetLun"`
-	Encrypted  bool   `mapstructure:"encrypted"`
+	AccessMode string   `mapstructure:"accessMode"`
+	AuthUser   string   `mapstructure:"authUserName"`
+	AuthPass   string   `mapstructure:"authPassword"`
+	AuthMethod string   `mapstructure:"authMethod"`
+	TgtDisco   bool     `mapstructure:"targetDiscovered"`
+	TgtIQN     string   `mapstructure:"targetIqn"`
+	TgtPortal  string   `mapstructure:"targetPortal"`
+	TgtPortals []string `mapstructure:"targetPortals"`
+	TgtIfaces  []string `mapstructure:"targetIfaces"`
+	VolumeID   string   `mapstructure:"volumeId"`
+	TgtLun     int      `mapstructure:"targetLun"`
+	Encrypted  bool     `mapstructure:"encrypted"`
+
+	// DiscoveryAuthMethod/User/Pass configure CHAP for the sendtargets
+	// discovery exchange, which is authenticated independently of the
+	// session login below.
+	DiscoveryAuthMethod string `mapstructure:"discoveryAuthMethod"`
+	DiscoveryAuthUser   string `mapstructure:"discoveryAuthUserName"`
+	DiscoveryAuthPass   string `mapstructure:"discoveryAuthPassword"`
+
+	// SessionAuthInUser/Pass are the "incoming" credentials the target uses
+	// to authenticate itself back to the initiator for mutual CHAP.
+	SessionAuthInUser string `mapstructure:"sessionAuthInUserName"`
+	SessionAuthInPass string `mapstructure:"sessionAuthInPassword"`
+
+	// Iface pins the attachment to a specific iscsiadm iface binding
+	// (NIC/initiator), instead of the default "tcp" software initiator.
+	Iface string `mapstructure:"iface"`
+	// InitiatorName, when set together with Iface, is written into the
+	// iface's iface.initiatorname before it's used.
+	InitiatorName string `mapstructure:"initiatorName"`
+}
+
+// ifaceFor returns the iface to bind portal index i to, falling back to the
+// single Iface field when TgtIfaces isn't set.
+func (conn *IscsiConnectorInfo) ifaceFor(i int) string {
+	if i < len(conn.TgtIfaces) {
+		return conn.TgtIfaces[i]
+	}
+	return conn.Iface
+}
+
+// authCreds bundles a CHAP username/password/mutual-incoming triple so
+// UpdateDiscoveryDb and SetSessionAuth can share one shape.
+type authCreds struct {
+	AuthMethod string
+	User       string
+	Pass       string
+	UserIn     string
+	PassIn     string
+}
+
+// attachmentStateDir is where per-attachment portal/iqn/iface tuples are
+// persisted so Disconnect can clean up sessions it didn't just create. The
+// lun is not recorded.
+const attachmentStateDir = "/var/lib/opensds/iscsi"
+
+// attachmentState is the sidecar record written by Connect and consumed by
+// Disconnect, since CSI NodeUnpublish/NodeUnstage only hand back the volume
+// ID and not the original connection properties.
+type attachmentState struct {
+	VolumeID string   `json:"volumeId"`
+	TgtIQN   string   `json:"targetIqn"`
+	Portals  []string `json:"portals"`
+	Ifaces   []string `json:"ifaces,omitempty"`
+}
+
+// portals returns the configured target portals, falling back to the
+// single-portal field for backward compatibility with older connection info.
+func (conn *IscsiConnectorInfo) portals() []string {
+	if len(conn.TgtPortals) != 0 {
+		return conn.TgtPortals
+	}
+	if conn.TgtPortal != "" {
+		return []string{conn.TgtPortal}
+	}
+	return nil
+}
+
+func attachmentStatePath(volumeID string) string {
+	return filepath.Join(attachmentStateDir, volumeID+".json")
+}
+
+// saveAttachmentState persists the portal/iqn tuple for volumeID so a later
+// Disconnect can log out from every portal that was logged in at Connect time.
+func saveAttachmentState(state *attachmentState) error {
+	if err := os.MkdirAll(attachmentStateDir, 0750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(attachmentStatePath(state.VolumeID), data, 0600)
+}
+
+// loadAttachmentState reads back the sidecar file written by Connect.
+func loadAttachmentState(volumeID string) (*attachmentState, error) {
+	data, err := ioutil.ReadFile(attachmentStatePath(volumeID))
+	if err != nil {
+		return nil, err
+	}
+	state := &attachmentState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// removeAttachmentState deletes the sidecar file once no references remain.
+func removeAttachmentState(volumeID string) error {
+	err := os.Remove(attachmentStatePath(volumeID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -91,6 +201,41 @@ func execCmd(name string, arg ...string) (string, error) {
 	return string(info), err
 }
 
+// withIface appends "-I <iface>" to an iscsiadm argument list when iface is
+// set, binding the command to that iface instead of the default session.
+func withIface(args []string, iface string) []string {
+	if iface == "" {
+		return args
+	}
+	return append(args, "-I", iface)
+}
+
+// EnsureIface creates the named iscsiadm iface binding if it doesn't already
+// exist and points it at initiatorName, so attachments can be pinned to a
+// specific NIC/initiator.
+func EnsureIface(name string, initiatorName string) error {
+	log.Printf("EnsureIface name: %s initiatorName: %s", name, initiatorName)
+
+	if _, err := execCmd("iscsiadm", "-m", "iface", "-I", name, "-o", "show"); err != nil {
+		if _, err := execCmd("iscsiadm", "-m", "iface", "-I", name, "-o", "new"); err != nil {
+			log.Printf("failed to create iface %s: %v", name, err)
+			return err
+		}
+	}
+
+	if initiatorName == "" {
+		return nil
+	}
+
+	info, err := execCmd("iscsiadm", "-m", "iface", "-I", name,
+		"-o", "update", "-n", "iface.initiatorname", "-v", initiatorName)
+	if err != nil {
+		log.Printf("failed to set initiatorname on iface %s: %v, %v", name, err, info)
+		return err
+	}
+	return nil
+}
+
 // GetInitiator returns all the ISCSI Initiator Name
 func GetInitiator() ([]string, error) {
 	res, err := execCmd("cat", "/etc/iscsi/initiatorname.iscsi")
@@ -114,9 +259,10 @@ func GetInitiator() ([]string, error) {
 }
 
 // Discovery ISCSI Target
-func Discovery(portal string) error {
-	log.Printf("Discovery portal: %s", portal)
-	_, err := execCmd("iscsiadm", "-m", "discovery", "-t", "sendtargets", "-p", portal)
+func Discovery(portal string, iface string) error {
+	log.Printf("Discovery portal: %s iface: %s", portal, iface)
+	args := withIface([]string{"-m", "discovery", "-t", "sendtargets", "-p", portal}, iface)
+	_, err := execCmd("iscsiadm", args...)
 	if err != nil {
 		log.Fatalf("Error encountered in sendtargets: %v", err)
 		return err
@@ -124,30 +270,72 @@ func Discovery(portal string) error {
 	return nil
 }
 
-// Login ISCSI Target
-func SetAuth(portal string, targetiqn string, name string, passwd string) error {
-	log.Println("Set user auth", portal, targetiqn, name, passwd)
-	// Set UserName
-	info, err := execCmd("iscsiadm", "-m", "node", "-p", portal, "-T", targetiqn,
-		"--op=update", "--name", "node.session.auth.username", "--value", name)
-	if err != nil {
-		log.Fatalf("Received error on set income username: %v, %v", err, info)
-		return err
+// UpdateDiscoveryDb sets discovery-time CHAP credentials for portal/iface in
+// the iscsiadm discovery database, so that the subsequent sendtargets
+// discovery is itself authenticated.
+func UpdateDiscoveryDb(portal string, iface string, creds authCreds) error {
+	log.Println("Set discovery auth", portal, iface, creds.AuthMethod, creds.User)
+
+	updates := [][]string{
+		{"discovery.sendtargets.auth.authmethod", creds.AuthMethod},
+		{"discovery.sendtargets.auth.username", creds.User},
+		{"discovery.sendtargets.auth.password", creds.Pass},
 	}
-	// Set Password
-	info, err = execCmd("iscsiadm", "-m", "node", "-p", portal, "-T", targetiqn,
-		"--op=update", "--name", "node.session.auth.password", "--value", passwd)
-	if err != nil {
-		log.Fatalf("Received error on set income password: %v, %v", err, info)
-		return err
+	if creds.UserIn != "" {
+		updates = append(updates,
+			[]string{"discovery.sendtargets.auth.username_in", creds.UserIn},
+			[]string{"discovery.sendtargets.auth.password_in", creds.PassIn})
+	}
+
+	for _, u := range updates {
+		args := withIface([]string{"-m", "discoverydb", "-t", "sendtargets", "-p", portal}, iface)
+		args = append(args, "-o", "update", "-n", u[0], "-v", u[1])
+
+		info, err := execCmd("iscsiadm", args...)
+		if err != nil {
+			log.Fatalf("Received error on set discovery auth %s: %v, %v", u[0], err, info)
+			return err
+		}
+	}
+	return nil
+}
+
+// SetSessionAuth sets session CHAP credentials for the node record
+// identified by portal/targetiqn, including the incoming (mutual CHAP)
+// username/password when provided.
+func SetSessionAuth(portal string, targetiqn string, iface string, creds authCreds) error {
+	log.Println("Set session auth", portal, targetiqn, iface, creds.AuthMethod, creds.User)
+
+	updates := [][]string{
+		{"node.session.auth.authmethod", creds.AuthMethod},
+		{"node.session.auth.username", creds.User},
+		{"node.session.auth.password", creds.Pass},
+	}
+	if creds.UserIn != "" {
+		updates = append(updates,
+			[]string{"node.session.auth.username_in", creds.UserIn},
+			[]string{"node.session.auth.password_in", creds.PassIn})
+	}
+
+	for _, u := range updates {
+		args := withIface([]string{"-m", "node", "-p", portal, "-T", targetiqn}, iface)
+		args = append(args, "--op=update", "--name", u[0], "--value", u[1])
+
+		info, err := execCmd("iscsiadm", args...)
+		if err != nil {
+			log.Fatalf("Received error on set session auth %s: %v, %v", u[0], err, info)
+			return err
+		}
 	}
 	return nil
 }
 
 // Login ISCSI Target
-func Login(portal string, targetiqn string) error {
-	log.Printf("Login portal: %s targetiqn: %s", portal, targetiqn)
-	info, err := execCmd("iscsiadm", "-m", "node", "-p", portal, "-T", targetiqn, "--login")
+func Login(portal string, targetiqn string, iface string) error {
+	log.Printf("Login portal: %s targetiqn: %s iface: %s", portal, targetiqn, iface)
+	args := withIface([]string{"-m", "node", "-p", portal, "-T", targetiqn}, iface)
+	args = append(args, "--login")
+	info, err := execCmd("iscsiadm", args...)
 	if err != nil {
 		log.Fatalln("Received error on login attempt", err, info)
 		return err
@@ -156,9 +344,11 @@ func Login(portal string, targetiqn string) error {
 }
 
 // Logout ISCSI Target
-func Logout(portal string, targetiqn string) error {
-	log.Printf("Logout portal: %s targetiqn: %s", portal, targetiqn)
-	info, err := execCmd("iscsiadm", "-m", "node", "-p", portal, "-T", targetiqn, "--logout")
+func Logout(portal string, targetiqn string, iface string) error {
+	log.Printf("Logout portal: %s targetiqn: %s iface: %s", portal, targetiqn, iface)
+	args := withIface([]string{"-m", "node", "-p", portal, "-T", targetiqn}, iface)
+	args = append(args, "--logout")
+	info, err := execCmd("iscsiadm", args...)
 	if err != nil {
 		log.Fatalln("Received error on logout attempt", err, info)
 		return err
@@ -167,9 +357,10 @@ func Logout(portal string, targetiqn string) error {
 }
 
 // Delete ISCSI Node
-func Delete(targetiqn string) (err error) {
-	log.Printf("Delete targetiqn: %s", targetiqn)
-	_, err = execCmd("iscsiadm", "-m", "node", "-o", "delete", "-T", targetiqn)
+func Delete(targetiqn string, iface string) (err error) {
+	log.Printf("Delete targetiqn: %s iface: %s", targetiqn, iface)
+	args := withIface([]string{"-m", "node", "-o", "delete", "-T", targetiqn}, iface)
+	_, err = execCmd("iscsiadm", args...)
 	if err != nil {
 		log.Fatalf("Received error on Delete attempt: %v", err)
 		return err
@@ -177,63 +368,250 @@ func Delete(targetiqn string) (err error) {
 	return nil
 }
 
+// devicePathForPortal builds the by-path device node the kernel exposes for
+// a single portal/iqn/lun tuple. The default tcp software initiator always
+// publishes the same "ip-<portal>-iscsi-<iqn>-lun-<lun>" node; a non-default
+// iface binding (hardware initiator, multiple NICs) publishes it under a
+// driver-specific prefix instead (e.g. "pci-<id>-ip-<portal>-iscsi-<iqn>-lun-
+// <lun>"), so callers glob for it via waitForPathToExist's non-tcp branch.
+// The portal stays part of the glob in both cases so two portals bound to
+// different ifaces never resolve to each other's device path.
+func devicePathForPortal(portal string, targetiqn string, targetlun string, iface string) string {
+	suffix := strings.Join([]string{"ip", portal, "iscsi", targetiqn, "lun", targetlun}, "-")
+	if iface == "" || iface == "default" {
+		return "/dev/disk/by-path/" + suffix
+	}
+	return filepath.Join("/dev/disk/by-path", "*-"+suffix)
+}
+
+// deviceTransportFor returns the deviceTransport to pass to
+// waitForPathToExist: the tcp fast-path for the default iface, or the iface
+// name itself so the non-tcp branch globs for the path instead of stat'ing
+// an exact name.
+func deviceTransportFor(iface string) string {
+	if iface == "" || iface == "default" {
+		return ISCSITranslateTCP
+	}
+	return iface
+}
+
 // Connect ISCSI Target
 func Connect(connMap map[string]interface{}) (string, error) {
 	conn := ParseIscsiConnectInfo(connMap)
 	log.Println(connMap)
 	log.Println(conn)
-	portal := conn.TgtPortal
+	portals := conn.portals()
 	targetiqn := conn.TgtIQN
 	targetlun := strconv.Itoa(conn.TgtLun)
 
-	log.Printf("Connect portal: %s targetiqn: %s targetlun: %s", portal, targetiqn, targetlun)
-	devicePath := strings.Join([]string{
-		"/dev/disk/by-path/ip",
-		portal,
-		"iscsi",
-		targetiqn,
-		"lun",
-		targetlun}, "-")
+	if len(portals) == 0 {
+		return "", errors.New("no target portals provided")
+	}
+
+	log.Printf("Connect portals: %s targetiqn: %s targetlun: %s", portals, targetiqn, targetlun)
 
-	isexist := waitForPathToExist(&devicePath, 1, ISCSITranslateTCP)
-	if !isexist {
+	var devicePaths []string
+	var ifaces []string
+	for i, portal := range portals {
+		iface := conn.ifaceFor(i)
+		if iface != "" && iface != "default" {
+			if err := EnsureIface(iface, conn.InitiatorName); err != nil {
+				return "", err
+			}
+		}
 
-		// Discovery
-		err := Discovery(portal)
-		if err != nil {
-			return "", err
+		devicePath := devicePathForPortal(portal, targetiqn, targetlun, iface)
+		transport := deviceTransportFor(iface)
+
+		if !waitForPathToExist(&devicePath, 1, transport) {
+			if len(conn.DiscoveryAuthMethod) != 0 {
+				if err := UpdateDiscoveryDb(portal, iface, authCreds{
+					AuthMethod: conn.DiscoveryAuthMethod,
+					User:       conn.DiscoveryAuthUser,
+					Pass:       conn.DiscoveryAuthPass,
+				}); err != nil {
+					return "", err
+				}
+			}
+
+			// Discovery
+			if err := Discovery(portal, iface); err != nil {
+				return "", err
+			}
+
+			if len(conn.AuthMethod) != 0 {
+				if err := SetSessionAuth(portal, targetiqn, iface, authCreds{
+					AuthMethod: conn.AuthMethod,
+					User:       conn.AuthUser,
+					Pass:       conn.AuthPass,
+					UserIn:     conn.SessionAuthInUser,
+					PassIn:     conn.SessionAuthInPass,
+				}); err != nil {
+					return "", err
+				}
+			}
+
+			// Login
+			if err := Login(portal, targetiqn, iface); err != nil {
+				return "", err
+			}
+
+			if !waitForPathToExist(&devicePath, 10, transport) {
+				return "", errors.New("Could not connect volume: Timeout after 10s")
+			}
+		}
+		devicePaths = append(devicePaths, devicePath)
+		ifaces = append(ifaces, iface)
+	}
+
+	if err := saveAttachmentState(&attachmentState{
+		VolumeID: conn.VolumeID,
+		TgtIQN:   targetiqn,
+		Portals:  portals,
+		Ifaces:   ifaces,
+	}); err != nil {
+		log.Printf("failed to persist iscsi attachment state for %s: %v", conn.VolumeID, err)
+	}
+
+	if len(devicePaths) == 1 {
+		return devicePaths[0], nil
+	}
+
+	mpathDevice, err := waitForMultipathDevice(devicePaths, 10)
+	if err != nil {
+		return "", err
+	}
+	return mpathDevice, nil
+}
+
+// waitForMultipathDevice polls for the multipath device backed by every path
+// in devicePaths, up to maxRetries seconds, and returns its /dev/mapper node.
+func waitForMultipathDevice(devicePaths []string, maxRetries int) (string, error) {
+	var mpathDevice string
+	for i := 0; i < maxRetries; i++ {
+		dev, err := resolveMultipathDevice(devicePaths)
+		if err == nil {
+			mpathDevice = dev
+			break
 		}
-		if len(conn.AuthMethod) != 0 {
-			SetAuth(portal, targetiqn, conn.AuthUser, conn.AuthPass)
+		if i == maxRetries-1 {
+			return "", err
 		}
-		//Login
-		err = Login(portal, targetiqn)
+		time.Sleep(time.Second)
+	}
+	return mpathDevice, nil
+}
+
+// resolveMultipathDevice walks /sys/block/dm-*/slaves looking for a device
+// mapper node whose slaves cover every by-path device in devicePaths, falling
+// back to parsing `multipath -l` if the sysfs lookup doesn't find a match.
+func resolveMultipathDevice(devicePaths []string) (string, error) {
+	wantedMajMin := make(map[string]bool, len(devicePaths))
+	for _, p := range devicePaths {
+		real, err := filepath.EvalSymlinks(p)
 		if err != nil {
 			return "", err
 		}
+		wantedMajMin[filepath.Base(real)] = true
+	}
+
+	dmDirs, err := filepath.Glob("/sys/block/dm-*")
+	if err != nil {
+		return "", err
+	}
+	for _, dmDir := range dmDirs {
+		slaves, err := filepath.Glob(filepath.Join(dmDir, "slaves", "*"))
+		if err != nil || len(slaves) == 0 {
+			continue
+		}
+		matched := 0
+		for _, slave := range slaves {
+			if wantedMajMin[filepath.Base(slave)] {
+				matched++
+			}
+		}
+		if matched == len(wantedMajMin) {
+			return "/dev/mapper/" + dmNameFromSysfs(filepath.Base(dmDir)), nil
+		}
+	}
+
+	return resolveMultipathDeviceFromCli(devicePaths)
+}
+
+// dmNameFromSysfs reads the dm-<N>/dm/name file to get the mapper name
+// (typically the multipath wwid).
+func dmNameFromSysfs(dmNode string) string {
+	name, err := ioutil.ReadFile(filepath.Join("/sys/block", dmNode, "dm", "name"))
+	if err != nil {
+		return dmNode
+	}
+	return strings.TrimSpace(string(name))
+}
 
-		isexist = waitForPathToExist(&devicePath, 10, ISCSITranslateTCP)
+// resolveMultipathDeviceFromCli shells out to `multipath -l` as a fallback
+// when the /sys/block lookup can't find a matching mapper device.
+func resolveMultipathDeviceFromCli(devicePaths []string) (string, error) {
+	out, err := execCmd("multipath", "-l")
+	if err != nil {
+		return "", err
+	}
 
-		if !isexist {
-			return "", errors.New("Could not connect volume: Timeout after 10s")
+	real := make(map[string]bool, len(devicePaths))
+	for _, p := range devicePaths {
+		if r, err := filepath.EvalSymlinks(p); err == nil {
+			real[r] = true
 		}
+	}
+
+	return parseMultipathList(out, real)
+}
 
+// parseMultipathList scans `multipath -l` output for the mapper device whose
+// path lines include one of wantedReal's resolved device paths. A map's
+// header line is the one carrying its "dm-<N>" node; the size, policy and
+// path lines that follow it belong to that map.
+// Split out of resolveMultipathDeviceFromCli so it can be unit tested without
+// shelling out.
+func parseMultipathList(out string, wantedReal map[string]bool) (string, error) {
+	var wwid string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		isHeader := false
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "dm-") {
+				isHeader = true
+				break
+			}
+		}
+		if isHeader {
+			wwid = fields[0]
+			continue
+		}
+		for _, f := range fields {
+			if wantedReal["/dev/"+f] {
+				return "/dev/mapper/" + wwid, nil
+			}
+		}
 	}
-	return devicePath, nil
+
+	return "", errors.New("could not resolve multipath device")
 }
 
-// Disconnect ISCSI Target
-func Disconnect(portal string, targetiqn string) error {
-	log.Printf("Disconnect portal: %s targetiqn: %s", portal, targetiqn)
+// Disconnect ISCSI Target for a single portal/iqn/iface.
+func Disconnect(portal string, targetiqn string, iface string) error {
+	log.Printf("Disconnect portal: %s targetiqn: %s iface: %s", portal, targetiqn, iface)
 
 	// Logout
-	err := Logout(portal, targetiqn)
+	err := Logout(portal, targetiqn, iface)
 	if err != nil {
 		return err
 	}
 
 	//Delete
-	err = Delete(targetiqn)
+	err = Delete(targetiqn, iface)
 	if err != nil {
 		return err
 	}
@@ -241,6 +619,88 @@ func Disconnect(portal string, targetiqn string) error {
 	return nil
 }
 
+// sessionRefCount counts the other persisted attachment-state files (all
+// but excludeVolumeID's own) that still reference targetiqn/portal, so
+// DisconnectVolume can tell whether a session is shared with another volume
+// (e.g. two LUNs exported over the same target) before tearing it down.
+func sessionRefCount(targetiqn string, portal string, excludeVolumeID string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(attachmentStateDir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, f := range files {
+		if strings.TrimSuffix(filepath.Base(f), ".json") == excludeVolumeID {
+			continue
+		}
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		state := &attachmentState{}
+		if err := json.Unmarshal(data, state); err != nil {
+			continue
+		}
+		if state.TgtIQN != targetiqn {
+			continue
+		}
+		for _, p := range state.Portals {
+			if p == portal {
+				count++
+				break
+			}
+		}
+	}
+	return count, nil
+}
+
+// DisconnectVolume logs out of and deletes every portal session recorded in
+// the volume's persisted attachment state (including the iface each portal
+// was bound to), then removes that state. It's the multi-portal counterpart
+// to Disconnect, used when the caller (e.g. CSI NodeUnstage) only has the
+// volume ID and not the original portal list.
+//
+// A portal/iqn session is only logged out and deleted once no other volume's
+// attachment state still references it, so two volumes sharing a target
+// (e.g. two LUNs behind one portal) don't tear down each other's session.
+// The state file itself is only removed once every portal has been
+// disconnected (or skipped via refcount), so a failed Disconnect leaves the
+// state in place for a retried NodeUnstage/NodeUnpublishVolume to finish the
+// cleanup instead of leaking the session.
+func DisconnectVolume(volumeID string) error {
+	state, err := loadAttachmentState(volumeID)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for i, portal := range state.Portals {
+		var iface string
+		if i < len(state.Ifaces) {
+			iface = state.Ifaces[i]
+		}
+
+		refs, err := sessionRefCount(state.TgtIQN, portal, volumeID)
+		if err != nil {
+			log.Printf("failed to check session refcount for portal %s targetiqn %s: %v", portal, state.TgtIQN, err)
+		} else if refs > 0 {
+			log.Printf("skipping disconnect of portal %s targetiqn %s: %d other volume(s) still attached", portal, state.TgtIQN, refs)
+			continue
+		}
+
+		if err := Disconnect(portal, state.TgtIQN, iface); err != nil {
+			log.Printf("failed to disconnect portal %s for volume %s: %v", portal, volumeID, err)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+
+	return removeAttachmentState(volumeID)
+}
+
 // GetFSType returns the File System Type of device
 func GetFSType(device string) string {
 	log.Printf("GetFSType: %s", device)
@@ -331,6 +791,56 @@ func Umount(mountpoint string) error {
 	return nil
 }
 
+// Linux ioctl request numbers for freezing/thawing a filesystem, from
+// <linux/fs.h>. Not defined by golang.org/x/sys/unix on all platforms, so
+// they're declared here directly.
+const (
+	fifreeze = 0xC0045877
+	fithaw   = 0xC0045878
+)
+
+// Freeze quiesces the filesystem mounted at mountpoint via the FIFREEZE
+// ioctl, so the storage backend can take a filesystem-consistent snapshot
+// instead of a crash-consistent one. Falls back to the fsfreeze CLI when the
+// ioctl isn't supported.
+func Freeze(mountpoint string) error {
+	log.Printf("Freeze mountpoint: %s", mountpoint)
+
+	f, err := os.Open(mountpoint)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := unix.IoctlSetInt(int(f.Fd()), fifreeze, 0); err != nil {
+		log.Printf("FIFREEZE ioctl failed on %s: %v, falling back to fsfreeze", mountpoint, err)
+		if info, cmdErr := execCmd("fsfreeze", "-f", mountpoint); cmdErr != nil {
+			return fmt.Errorf("failed to freeze %s: %v, %s", mountpoint, cmdErr, info)
+		}
+	}
+	return nil
+}
+
+// Unfreeze thaws a filesystem previously quiesced by Freeze, via the FITHAW
+// ioctl, falling back to the fsfreeze CLI when the ioctl isn't supported.
+func Unfreeze(mountpoint string) error {
+	log.Printf("Unfreeze mountpoint: %s", mountpoint)
+
+	f, err := os.Open(mountpoint)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := unix.IoctlSetInt(int(f.Fd()), fithaw, 0); err != nil {
+		log.Printf("FITHAW ioctl failed on %s: %v, falling back to fsfreeze", mountpoint, err)
+		if info, cmdErr := execCmd("fsfreeze", "-u", mountpoint); cmdErr != nil {
+			return fmt.Errorf("failed to unfreeze %s: %v, %s", mountpoint, cmdErr, info)
+		}
+	}
+	return nil
+}
+
 // ParseIscsiConnectInfo decode
 func ParseIscsiConnectInfo(connectInfo map[string]interface{}) *IscsiConnectorInfo {
 	var con IscsiConnectorInfo
@@ -0,0 +1,85 @@
+package iscsi
+
+import "testing"
+
+func TestParseMultipathList(t *testing.T) {
+	tests := []struct {
+		name       string
+		out        string
+		wantedReal map[string]bool
+		want       string
+		wantErr    bool
+	}{
+		{
+			name: "matching slave",
+			out: "mpatha (36001405abcdef) dm-0 LIO-ORG,block\n" +
+				"size=10G features='1 queue_if_no_path' hwhandler='1 alua' wp=rw\n" +
+				"`-+- policy='round-robin 0' prio=1 status=active\n" +
+				"  `- 8:0:0:1 sda 8:0 active ready running\n",
+			wantedReal: map[string]bool{"/dev/sda": true},
+			want:       "/dev/mapper/mpatha",
+		},
+		{
+			name: "no matching slave",
+			out: "mpatha (36001405abcdef) dm-0 LIO-ORG,block\n" +
+				"  `- 8:0:0:1 sda 8:0 active ready running\n",
+			wantedReal: map[string]bool{"/dev/sdb": true},
+			wantErr:    true,
+		},
+		{
+			name:       "empty output",
+			out:        "",
+			wantedReal: map[string]bool{"/dev/sda": true},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMultipathList(tt.out, tt.wantedReal)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got device %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevicePathForPortal(t *testing.T) {
+	tests := []struct {
+		name   string
+		portal string
+		iface  string
+		want   string
+	}{
+		{
+			name:   "default iface",
+			portal: "192.168.0.1:3260",
+			iface:  "",
+			want:   "/dev/disk/by-path/ip-192.168.0.1:3260-iscsi-iqn.test-lun-0",
+		},
+		{
+			name:   "non-default iface globs but keeps portal",
+			portal: "192.168.0.1:3260",
+			iface:  "eth1",
+			want:   "/dev/disk/by-path/*-ip-192.168.0.1:3260-iscsi-iqn.test-lun-0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := devicePathForPortal(tt.portal, "iqn.test", "0", tt.iface)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
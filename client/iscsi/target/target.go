@@ -0,0 +1,236 @@
+// Package target implements the server side of the iscsi package: exporting
+// a local block file or volume as an iSCSI target, so a node can publish a
+// volume for host-mode workloads. It is modeled on longhorn's
+// go-iscsi-helper and supports both the tgt (tgtadm) and LIO (targetcli)
+// backends.
+package target
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Driver selects which userspace iSCSI target implementation the package
+// drives: tgt (tgtadm) or LIO (targetcli).
+type Driver string
+
+const (
+	// DriverTgt drives the tgt daemon via tgtadm.
+	DriverTgt Driver = "tgt"
+	// DriverLIO drives the Linux-IO target via targetcli.
+	DriverLIO Driver = "lio"
+)
+
+func execCmd(name string, arg ...string) (string, error) {
+	log.Printf("Command: %s %s\n", name, strings.Join(arg, " "))
+	info, err := exec.Command(name, arg...).CombinedOutput()
+	return string(info), err
+}
+
+// CreateTarget creates a new iSCSI target with the given target ID and IQN.
+func CreateTarget(driver Driver, tid int, iqn string) error {
+	switch driver {
+	case DriverTgt:
+		info, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "target", "--op", "new",
+			"--tid", strconv.Itoa(tid), "--targetname", iqn)
+		if err != nil {
+			return fmt.Errorf("failed to create target %s: %v, %s", iqn, err, info)
+		}
+		return nil
+	case DriverLIO:
+		info, err := execCmd("targetcli", fmt.Sprintf("/iscsi create %s", iqn))
+		if err != nil {
+			return fmt.Errorf("failed to create target %s: %v, %s", iqn, err, info)
+		}
+		return nil
+	default:
+		return unsupportedDriver(driver)
+	}
+}
+
+// AddLun exports backingFile as lun on the target identified by tid/iqn.
+func AddLun(driver Driver, tid int, iqn string, lun int, backingFile string) error {
+	switch driver {
+	case DriverTgt:
+		info, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "logicalunit", "--op", "new",
+			"--tid", strconv.Itoa(tid), "--lun", strconv.Itoa(lun), "--backing-store", backingFile)
+		if err != nil {
+			return fmt.Errorf("failed to add lun %d to target %d: %v, %s", lun, tid, err, info)
+		}
+		return nil
+	case DriverLIO:
+		backstoreName := fmt.Sprintf("backstore-%d-%d", tid, lun)
+		if info, err := execCmd("targetcli", fmt.Sprintf("/backstores/fileio create %s %s", backstoreName, backingFile)); err != nil {
+			return fmt.Errorf("failed to create backstore for lun %d on %s: %v, %s", lun, iqn, err, info)
+		}
+		info, err := execCmd("targetcli", fmt.Sprintf("/iscsi/%s/tpg1/luns create /backstores/fileio/%s lun=%d", iqn, backstoreName, lun))
+		if err != nil {
+			return fmt.Errorf("failed to add lun %d to target %s: %v, %s", lun, iqn, err, info)
+		}
+		return nil
+	default:
+		return unsupportedDriver(driver)
+	}
+}
+
+// BindInitiator grants the initiator IQN access to the target (an ACL entry
+// in LIO terms).
+func BindInitiator(driver Driver, tid int, iqn string, initiator string) error {
+	switch driver {
+	case DriverTgt:
+		info, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "target", "--op", "bind",
+			"--tid", strconv.Itoa(tid), "--initiator-name", initiator)
+		if err != nil {
+			return fmt.Errorf("failed to bind initiator %s to target %d: %v, %s", initiator, tid, err, info)
+		}
+		return nil
+	case DriverLIO:
+		info, err := execCmd("targetcli", fmt.Sprintf("/iscsi/%s/tpg1/acls create %s", iqn, initiator))
+		if err != nil {
+			return fmt.Errorf("failed to bind initiator %s to target %s: %v, %s", initiator, iqn, err, info)
+		}
+		return nil
+	default:
+		return unsupportedDriver(driver)
+	}
+}
+
+// UnbindInitiator revokes the initiator IQN's access to the target.
+func UnbindInitiator(driver Driver, tid int, iqn string, initiator string) error {
+	switch driver {
+	case DriverTgt:
+		info, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "target", "--op", "unbind",
+			"--tid", strconv.Itoa(tid), "--initiator-name", initiator)
+		if err != nil {
+			return fmt.Errorf("failed to unbind initiator %s from target %d: %v, %s", initiator, tid, err, info)
+		}
+		return nil
+	case DriverLIO:
+		info, err := execCmd("targetcli", fmt.Sprintf("/iscsi/%s/tpg1/acls delete %s", iqn, initiator))
+		if err != nil {
+			return fmt.Errorf("failed to unbind initiator %s from target %s: %v, %s", initiator, iqn, err, info)
+		}
+		return nil
+	default:
+		return unsupportedDriver(driver)
+	}
+}
+
+// SetChap sets the incoming CHAP username/password a target requires of
+// initiators logging in.
+func SetChap(driver Driver, tid int, iqn string, user string, pass string) error {
+	switch driver {
+	case DriverTgt:
+		info, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "account", "--op", "new",
+			"--user", user, "--password", pass)
+		if err != nil {
+			return fmt.Errorf("failed to create account %s: %v, %s", user, err, info)
+		}
+		info, err = execCmd("tgtadm", "--lld", "iscsi", "--mode", "account", "--op", "bind",
+			"--tid", strconv.Itoa(tid), "--user", user)
+		if err != nil {
+			return fmt.Errorf("failed to bind account %s to target %d: %v, %s", user, tid, err, info)
+		}
+		return nil
+	case DriverLIO:
+		info, err := execCmd("targetcli", fmt.Sprintf(
+			"/iscsi/%s/tpg1 set auth userid=%s password=%s", iqn, user, pass))
+		if err != nil {
+			return fmt.Errorf("failed to set chap for target %s: %v, %s", iqn, err, info)
+		}
+		return nil
+	default:
+		return unsupportedDriver(driver)
+	}
+}
+
+// DeleteLun removes lun from the target identified by tid/iqn.
+func DeleteLun(driver Driver, tid int, iqn string, lun int) error {
+	switch driver {
+	case DriverTgt:
+		info, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "logicalunit", "--op", "delete",
+			"--tid", strconv.Itoa(tid), "--lun", strconv.Itoa(lun))
+		if err != nil {
+			return fmt.Errorf("failed to delete lun %d from target %d: %v, %s", lun, tid, err, info)
+		}
+		return nil
+	case DriverLIO:
+		backstoreName := fmt.Sprintf("backstore-%d-%d", tid, lun)
+		info, err := execCmd("targetcli", fmt.Sprintf("/iscsi/%s/tpg1/luns delete %d", iqn, lun))
+		if err != nil {
+			return fmt.Errorf("failed to delete lun %d from target %s: %v, %s", lun, iqn, err, info)
+		}
+		if info, err := execCmd("targetcli", fmt.Sprintf("/backstores/fileio delete %s", backstoreName)); err != nil {
+			return fmt.Errorf("failed to delete backstore for lun %d on %s: %v, %s", lun, iqn, err, info)
+		}
+		return nil
+	default:
+		return unsupportedDriver(driver)
+	}
+}
+
+// DeleteTarget tears down the target identified by tid/iqn.
+func DeleteTarget(driver Driver, tid int, iqn string) error {
+	switch driver {
+	case DriverTgt:
+		info, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "target", "--op", "delete",
+			"--tid", strconv.Itoa(tid))
+		if err != nil {
+			return fmt.Errorf("failed to delete target %d: %v, %s", tid, err, info)
+		}
+		return nil
+	case DriverLIO:
+		info, err := execCmd("targetcli", fmt.Sprintf("/iscsi delete %s", iqn))
+		if err != nil {
+			return fmt.Errorf("failed to delete target %s: %v, %s", iqn, err, info)
+		}
+		return nil
+	default:
+		return unsupportedDriver(driver)
+	}
+}
+
+// GetTargetTid looks up the target ID tgtadm assigned to iqn by parsing
+// `tgtadm --mode target --op show`. It only applies to the tgt backend;
+// LIO addresses targets by IQN directly and has no numeric tid.
+func GetTargetTid(iqn string) (int, error) {
+	out, err := execCmd("tgtadm", "--lld", "iscsi", "--mode", "target", "--op", "show")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list targets: %v, %s", err, out)
+	}
+	return parseTargetTid(out, iqn)
+}
+
+// parseTargetTid scans `tgtadm --mode target --op show` output for the tid
+// of the target whose IQN matches iqn. Split out of GetTargetTid so it can
+// be unit tested without shelling out.
+func parseTargetTid(out string, iqn string) (int, error) {
+	for _, line := range strings.Split(out, "\n") {
+		// Example: "Target 1: iqn.2018-10.io.opensds:test"
+		if !strings.HasPrefix(line, "Target ") {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(line, "Target "), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.TrimSpace(fields[1]) != iqn {
+			continue
+		}
+		tid, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse tid from %q: %v", line, err)
+		}
+		return tid, nil
+	}
+
+	return 0, errors.New("target not found: " + iqn)
+}
+
+func unsupportedDriver(driver Driver) error {
+	return fmt.Errorf("unsupported target driver: %s", driver)
+}
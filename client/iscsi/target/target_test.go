@@ -0,0 +1,59 @@
+package target
+
+import "testing"
+
+func TestParseTargetTid(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		iqn     string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "matching target",
+			out: "Target 1: iqn.2018-10.io.opensds:test\n" +
+				"    System information:\n" +
+				"        Driver: iscsi\n",
+			iqn:  "iqn.2018-10.io.opensds:test",
+			want: 1,
+		},
+		{
+			name: "second of several targets",
+			out: "Target 1: iqn.2018-10.io.opensds:other\n" +
+				"Target 2: iqn.2018-10.io.opensds:test\n",
+			iqn:  "iqn.2018-10.io.opensds:test",
+			want: 2,
+		},
+		{
+			name:    "no match",
+			out:     "Target 1: iqn.2018-10.io.opensds:other\n",
+			iqn:     "iqn.2018-10.io.opensds:test",
+			wantErr: true,
+		},
+		{
+			name:    "empty output",
+			out:     "",
+			iqn:     "iqn.2018-10.io.opensds:test",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTargetTid(tt.out, tt.iqn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got tid %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2018 Huawei Technologies Co., Ltd. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opensds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/opensds/nbp/client/iscsi"
+	sdsClient "github.com/opensds/nbp/client/opensds"
+	"github.com/opensds/opensds/pkg/model"
+	"golang.org/x/net/context"
+)
+
+// mountStateDir holds, per volume ID, the mountpoint NodePublishVolume last
+// published it at. CreateSnapshot consults it to find what to freeze.
+const mountStateDir = "/var/lib/opensds/mounts"
+
+// activeMount returns the node-local mountpoint currently published for
+// volumeID, as recorded by NodePublishVolume.
+func activeMount(volumeID string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(mountStateDir, volumeID))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// CreateSnapshot creates an OpenSDS volume snapshot. When req.Parameters
+// carries "fsFreeze": "true", the volume's currently published mount is
+// quiesced via iscsi.Freeze before the snapshot is taken and thawed via
+// iscsi.Unfreeze afterwards (even on error), producing a filesystem-
+// consistent rather than crash-consistent snapshot.
+func (p *Plugin) CreateSnapshot(
+	ctx context.Context,
+	req *csi.CreateSnapshotRequest,
+) (*csi.CreateSnapshotResponse, error) {
+	volumeID := req.GetSourceVolumeId()
+
+	if req.GetParameters()["fsFreeze"] == "true" {
+		mountpoint, err := activeMount(volumeID)
+		if err != nil {
+			return nil, fmt.Errorf("fsFreeze requested but no active mount found for volume %s: %v", volumeID, err)
+		}
+
+		if err := iscsi.Freeze(mountpoint); err != nil {
+			return nil, fmt.Errorf("failed to freeze %s: %v", mountpoint, err)
+		}
+		defer func() {
+			if err := iscsi.Unfreeze(mountpoint); err != nil {
+				log.Printf("failed to unfreeze %s: %v", mountpoint, err)
+			}
+		}()
+	}
+
+	snap, err := sdsClient.GetClient(p.Endpoint).CreateVolumeSnapshot(&model.VolumeSnapshotSpec{
+		Name:     req.GetName(),
+		VolumeId: volumeID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &csi.CreateSnapshotResponse{
+		Snapshot: &csi.Snapshot{
+			Id:             snap.GetId(),
+			SourceVolumeId: volumeID,
+			Status:         &csi.SnapshotStatus{Type: csi.SnapshotStatus_READY},
+		},
+	}, nil
+}
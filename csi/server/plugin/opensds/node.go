@@ -0,0 +1,105 @@
+// Copyright (c) 2018 Huawei Technologies Co., Ltd. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opensds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	csi "github.com/container-storage-interface/spec/lib/go/csi/v0"
+	"github.com/opensds/nbp/client/iscsi"
+	"golang.org/x/net/context"
+)
+
+// saveMountState records mountpoint as volumeID's active mount, so a later
+// CreateSnapshot with fsFreeze=true knows what to freeze.
+func saveMountState(volumeID string, mountpoint string) error {
+	if err := os.MkdirAll(mountStateDir, 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(mountStateDir, volumeID), []byte(mountpoint), 0600)
+}
+
+// removeMountState clears the active-mount record written by
+// saveMountState, once the volume is unpublished.
+func removeMountState(volumeID string) error {
+	err := os.Remove(filepath.Join(mountStateDir, volumeID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// NodePublishVolume connects the iSCSI session described by req's publish
+// info, formats and mounts it at req.GetTargetPath(), and records that
+// mountpoint via saveMountState so CreateSnapshot's fsFreeze option can find
+// it later.
+func (p *Plugin) NodePublishVolume(
+	ctx context.Context,
+	req *csi.NodePublishVolumeRequest,
+) (*csi.NodePublishVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	targetPath := req.GetTargetPath()
+
+	connMap := make(map[string]interface{}, len(req.GetPublishInfo())+1)
+	for k, v := range req.GetPublishInfo() {
+		connMap[k] = v
+	}
+	connMap["volumeId"] = volumeID
+
+	device, err := iscsi.Connect(connMap)
+	if err != nil {
+		return nil, err
+	}
+
+	fsType := "ext4"
+	if mnt := req.GetVolumeCapability().GetMount(); mnt != nil && mnt.GetFsType() != "" {
+		fsType = mnt.GetFsType()
+	}
+
+	if err := iscsi.FormatAndMount(device, fsType, targetPath); err != nil {
+		return nil, err
+	}
+
+	if err := saveMountState(volumeID, targetPath); err != nil {
+		return nil, err
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume unmounts req.GetTargetPath(), tears down the iSCSI
+// session for req.GetVolumeId(), and clears its mount-state record.
+func (p *Plugin) NodeUnpublishVolume(
+	ctx context.Context,
+	req *csi.NodeUnpublishVolumeRequest,
+) (*csi.NodeUnpublishVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+
+	if err := iscsi.Umount(req.GetTargetPath()); err != nil {
+		return nil, err
+	}
+
+	if err := iscsi.DisconnectVolume(volumeID); err != nil {
+		return nil, err
+	}
+
+	if err := removeMountState(volumeID); err != nil {
+		return nil, err
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
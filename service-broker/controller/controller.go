@@ -16,7 +16,9 @@ package controller
 import (
 	"fmt"
 	"log"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/kubernetes-incubator/service-catalog/contrib/pkg/broker/controller"
 	"github.com/kubernetes-incubator/service-catalog/contrib/pkg/brokerapi"
@@ -24,25 +26,76 @@ import (
 	"github.com/opensds/opensds/pkg/model"
 )
 
+// volumeServiceID/snapshotServiceID identify the two brokerapi.Services this
+// broker advertises: ordinary volume provisioning, and snapshot/clone.
+const (
+	volumeServiceID   = "4f6e6cf6-ffdd-425f-a2c7-3c9258ad2468"
+	snapshotServiceID = "a2b6e6cf6-ffdd-425f-a2c7-3c9258ad2469"
+	snapshotPlanID    = "b3c7e6cf6-ffdd-425f-a2c7-3c9258ad246a"
+)
+
 type openSDSServiceInstance struct {
 	Name       string
 	Credential *brokerapi.Credential
 }
 
+// operationType identifies which kind of long-running OpenSDS call an
+// operation token refers to.
+type operationType string
+
+const (
+	opProvision   operationType = "provision"
+	opDeprovision operationType = "deprovision"
+	opBind        operationType = "bind"
+)
+
+// operationState is the broker-facing state GetServiceInstanceLastOperation
+// reports, per the Open Service Broker API contract.
+type operationState string
+
+const (
+	stateInProgress operationState = "in progress"
+	stateSucceeded  operationState = "succeeded"
+	stateFailed     operationState = "failed"
+)
+
+// trackedOperation records enough about an in-flight async call to poll its
+// backend status later: what kind of call it was, which OpenSDS resource
+// (volume or attachment) it's waiting on, and the last known state.
+type trackedOperation struct {
+	OpType operationType
+	// VolumeID starts out as a placeholder (the instanceID, volume ID or
+	// snapshotID the call was made with) for opProvision/opBind, since the real backend
+	// resource ID isn't known until the goroutine below finishes; Ready
+	// flips true once it's been patched to that real ID, so
+	// GetServiceInstanceLastOperation knows when it's safe to poll the
+	// backend with it.
+	VolumeID    string
+	Ready       bool
+	State       operationState
+	Description string
+	UpdatedAt   time.Time
+}
+
 type openSDSController struct {
 	Endpoint string
 
 	rwMutex     sync.RWMutex
 	instanceMap map[string]*openSDSServiceInstance
+
+	opMutex    sync.RWMutex
+	operations map[string]*trackedOperation
 }
 
 // CreateController creates an instance of an OpenSDS service broker controller.
 func CreateController(edp string) controller.Controller {
 	var instanceMap = make(map[string]*openSDSServiceInstance)
+	var operations = make(map[string]*trackedOperation)
 
 	return &openSDSController{
 		Endpoint:    edp,
 		instanceMap: instanceMap,
+		operations:  operations,
 	}
 }
 
@@ -60,6 +113,7 @@ func (c *openSDSController) Catalog() (*brokerapi.Catalog, error) {
 			Description: prf.GetDescription(),
 			Metadata:    prf.Extra,
 			Free:        true,
+			Schemas:     createInstanceSchemas(schemaFromExtra(prf.Extra)),
 		}
 		plans = append(plans, plan)
 	}
@@ -68,46 +122,285 @@ func (c *openSDSController) Catalog() (*brokerapi.Catalog, error) {
 		Services: []*brokerapi.Service{
 			{
 				Name:        "opensds-service",
-				ID:          "4f6e6cf6-ffdd-425f-a2c7-3c9258ad2468",
+				ID:          volumeServiceID,
 				Description: "Policy based storage service",
 				Plans:       plans,
 				Bindable:    true,
 			},
+			{
+				Name:        "opensds-snapshot",
+				ID:          snapshotServiceID,
+				Description: "Snapshot an existing volume and bind a clone of it",
+				Bindable:    true,
+				Plans: []brokerapi.ServicePlan{
+					{
+						Name:        "default",
+						ID:          snapshotPlanID,
+						Description: "Create a snapshot, and clone it into a new volume on bind",
+						Free:        true,
+						Schemas:     createInstanceSchemas(snapshotParametersSchema()),
+					},
+				},
+			},
 		},
 	}, nil
 }
 
+// createInstanceSchemas wraps a JSON-schema "parameters" object as the
+// service_instance.create schema a brokerapi.ServicePlan advertises.
+func createInstanceSchemas(parameters map[string]interface{}) *brokerapi.Schemas {
+	return &brokerapi.Schemas{
+		ServiceInstance: &brokerapi.ServiceInstanceSchema{
+			Create: &brokerapi.Schema{Parameters: parameters},
+		},
+	}
+}
+
+// schemaFromExtra builds a JSON-schema "parameters" object describing a
+// profile's Extra map, inferring each property's JSON schema type from the
+// Go kind of its value.
+func schemaFromExtra(extra model.ExtraSpec) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for k, v := range extra {
+		properties[k] = map[string]interface{}{"type": jsonSchemaType(v)}
+	}
+	return map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-04/schema#",
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// jsonSchemaType maps a Go value's kind onto the closest JSON schema type.
+func jsonSchemaType(v interface{}) string {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "number"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "string"
+	}
+}
+
+// snapshotParametersSchema describes the single required parameter the
+// opensds-snapshot service's instance creation takes.
+func snapshotParametersSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-04/schema#",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"sourceVolumeId": map[string]interface{}{
+				"type":        "string",
+				"description": "ID of the volume to snapshot",
+			},
+		},
+		"required": []string{"sourceVolumeId"},
+	}
+}
+
+// startOperation registers a new in-flight operation for volumeID and
+// returns the opaque token the caller should hand back to the broker.
+func (c *openSDSController) startOperation(opType operationType, volumeID string) string {
+	c.opMutex.Lock()
+	defer c.opMutex.Unlock()
+
+	opID := fmt.Sprintf("%s-%s-%d", opType, volumeID, time.Now().UnixNano())
+	c.operations[opID] = &trackedOperation{
+		OpType:      opType,
+		VolumeID:    volumeID,
+		State:       stateInProgress,
+		Description: "operation in progress",
+		UpdatedAt:   time.Now(),
+	}
+	return opID
+}
+
+// finishOperation records the terminal state of a goroutine-driven call.
+// GetServiceInstanceLastOperation still polls the OpenSDS backend for the
+// authoritative status; this only covers the case where the initial call
+// itself failed before the backend ever started tracking the resource.
+func (c *openSDSController) finishOperation(opID string, state operationState, description string) {
+	c.opMutex.Lock()
+	defer c.opMutex.Unlock()
+
+	op, ok := c.operations[opID]
+	if !ok {
+		return
+	}
+	op.State = state
+	op.Description = description
+	op.UpdatedAt = time.Now()
+}
+
+// translateStatus maps an OpenSDS volume/attachment status onto the
+// in progress/succeeded/failed vocabulary the Open Service Broker API
+// expects from GetServiceInstanceLastOperation.
+func translateStatus(status string) (operationState, string) {
+	switch status {
+	case "creating", "deleting", "attaching", "detaching":
+		return stateInProgress, "resource status: " + status
+	case "available", "inUse":
+		return stateSucceeded, "resource status: " + status
+	case "error", "errorDeleting":
+		return stateFailed, "resource status: " + status
+	default:
+		return stateInProgress, "resource status: " + status
+	}
+}
+
 func (c *openSDSController) GetServiceInstanceLastOperation(
 	instanceID, serviceID, planID, operation string,
 ) (*brokerapi.LastOperationResponse, error) {
-	return nil, fmt.Errorf("Not implemented!")
-}
+	c.opMutex.RLock()
+	op, ok := c.operations[operation]
+	if !ok {
+		c.opMutex.RUnlock()
+		return nil, fmt.Errorf("unknown operation %s", operation)
+	}
+	// Snapshot every field we need while still holding the lock: op is a
+	// pointer shared with the goroutines behind async calls, which write
+	// these same fields under opMutex.Lock() as the operation progresses.
+	opType, volumeID, ready, state, description := op.OpType, op.VolumeID, op.Ready, op.State, op.Description
+	c.opMutex.RUnlock()
 
-func (c *openSDSController) CreateServiceInstance(
-	instanceID string,
-	req *brokerapi.CreateServiceInstanceRequest,
-) (*brokerapi.CreateServiceInstanceResponse, error) {
-	c.rwMutex.Lock()
-	defer c.rwMutex.Unlock()
+	// volumeID is still the opProvision/opBind placeholder until the
+	// goroutine that created it patches in the real backend ID; polling the
+	// backend with that placeholder would misreport the call as failed, so
+	// report the tracked in-progress state instead until it's Ready. A call
+	// the goroutine already recorded as failed is reported as such for every
+	// operation type.
+	if state == stateFailed || ((opType == opProvision || opType == opBind) && !ready) {
+		return &brokerapi.LastOperationResponse{
+			State:       string(state),
+			Description: description,
+		}, nil
+	}
+
+	client := sdsController.GetClient(c.Endpoint)
+
+	switch opType {
+	case opProvision:
+		vol, err := client.GetVolume(volumeID)
+		if err != nil {
+			return &brokerapi.LastOperationResponse{
+				State:       string(stateFailed),
+				Description: err.Error(),
+			}, nil
+		}
+		state, desc := translateStatus(vol.Status)
+		return &brokerapi.LastOperationResponse{State: string(state), Description: desc}, nil
 
-	var in = new(model.VolumeSpec)
-	if nameInterface, ok := req.Parameters["name"]; ok {
+	case opDeprovision:
+		vol, err := client.GetVolume(volumeID)
+		if err != nil {
+			// The volume is gone: deletion has completed.
+			return &brokerapi.LastOperationResponse{
+				State:       string(stateSucceeded),
+				Description: "volume deleted",
+			}, nil
+		}
+		state, desc := translateStatus(vol.Status)
+		if state == stateSucceeded {
+			// translateStatus treats "available"/"inUse" as a succeeded
+			// terminal state, but for a deprovision the volume still
+			// existing means the delete hasn't landed yet.
+			state, desc = stateInProgress, "volume is being deleted"
+		}
+		return &brokerapi.LastOperationResponse{State: string(state), Description: desc}, nil
+
+	case opBind:
+		atc, err := client.GetVolumeAttachment(volumeID)
+		if err != nil {
+			return &brokerapi.LastOperationResponse{
+				State:       string(stateFailed),
+				Description: err.Error(),
+			}, nil
+		}
+		state, desc := translateStatus(atc.Status)
+		return &brokerapi.LastOperationResponse{State: string(state), Description: desc}, nil
+
+	default:
+		return &brokerapi.LastOperationResponse{
+			State:       string(state),
+			Description: description,
+		}, nil
+	}
+}
+
+// volumeSpecFromParameters builds a model.VolumeSpec from the free-form
+// parameters an OSB CreateServiceInstanceRequest carries.
+func volumeSpecFromParameters(parameters map[string]interface{}) *model.VolumeSpec {
+	in := new(model.VolumeSpec)
+	if nameInterface, ok := parameters["name"]; ok {
 		in.Name = nameInterface.(string)
 	}
-	if despInterface, ok := req.Parameters["description"]; ok {
+	if despInterface, ok := parameters["description"]; ok {
 		in.Description = despInterface.(string)
 	}
-	if capInterface, ok := req.Parameters["capacity"]; ok {
+	if capInterface, ok := parameters["capacity"]; ok {
 		in.Size = capInterface.(int64)
 	}
-	if lvInterface, ok := req.Parameters["lvPath"]; ok {
+	if lvInterface, ok := parameters["lvPath"]; ok {
 		in.Metadata["lvPath"] = lvInterface.(string)
 	}
+	return in
+}
 
-	vol, err := sdsController.GetClient(c.Endpoint).CreateVolume(in)
-	if err != nil {
-		return nil, err
+// credentialValue safely reads key out of instance's credential map.
+// instance.Credential is shared with the goroutines behind async Bind/
+// CreateServiceInstance calls, which patch it in after RemoveServiceInstance/
+// UnBind may already have released the instanceMap lookup lock, so every
+// access has to go through c.rwMutex rather than dereferencing the map
+// directly.
+func (c *openSDSController) credentialValue(instance *openSDSServiceInstance, key string) (interface{}, bool) {
+	c.rwMutex.RLock()
+	defer c.rwMutex.RUnlock()
+
+	v, ok := (*instance.Credential)[key]
+	return v, ok
+}
+
+// setCredential safely writes key into instance's credential map.
+func (c *openSDSController) setCredential(instance *openSDSServiceInstance, key string, value interface{}) {
+	c.rwMutex.Lock()
+	defer c.rwMutex.Unlock()
+
+	(*instance.Credential)[key] = value
+}
+
+// deleteCredential safely removes key from instance's credential map.
+func (c *openSDSController) deleteCredential(instance *openSDSServiceInstance, key string) {
+	c.rwMutex.Lock()
+	defer c.rwMutex.Unlock()
+
+	delete(*instance.Credential, key)
+}
+
+// credentialSnapshot safely copies out instance's entire credential map, for
+// returning to the broker once a synchronous or async call completes.
+func (c *openSDSController) credentialSnapshot(instance *openSDSServiceInstance) brokerapi.Credential {
+	c.rwMutex.RLock()
+	defer c.rwMutex.RUnlock()
+
+	snap := make(brokerapi.Credential, len(*instance.Credential))
+	for k, v := range *instance.Credential {
+		snap[k] = v
 	}
+	return snap
+}
+
+// storeInstance records the OpenSDS volume backing instanceID so Bind/
+// RemoveServiceInstance can find it later.
+func (c *openSDSController) storeInstance(instanceID string, vol *model.VolumeSpec) {
+	c.rwMutex.Lock()
+	defer c.rwMutex.Unlock()
 
 	c.instanceMap[instanceID] = &openSDSServiceInstance{
 		Name: instanceID,
@@ -119,7 +412,104 @@ func (c *openSDSController) CreateServiceInstance(
 
 	log.Printf("Created User Provided Service Instance:\n%v\n",
 		c.instanceMap[instanceID])
-	return &brokerapi.CreateServiceInstanceResponse{}, nil
+}
+
+func (c *openSDSController) CreateServiceInstance(
+	instanceID string,
+	req *brokerapi.CreateServiceInstanceRequest,
+) (*brokerapi.CreateServiceInstanceResponse, error) {
+	if req.ServiceID == snapshotServiceID {
+		return c.createSnapshotInstance(instanceID, req)
+	}
+
+	in := volumeSpecFromParameters(req.Parameters)
+
+	if !req.AcceptsIncomplete {
+		vol, err := sdsController.GetClient(c.Endpoint).CreateVolume(in)
+		if err != nil {
+			return nil, err
+		}
+		c.storeInstance(instanceID, vol)
+		return &brokerapi.CreateServiceInstanceResponse{}, nil
+	}
+
+	opID := c.startOperation(opProvision, instanceID)
+	go func() {
+		vol, err := sdsController.GetClient(c.Endpoint).CreateVolume(in)
+		if err != nil {
+			c.finishOperation(opID, stateFailed, err.Error())
+			return
+		}
+		c.storeInstance(instanceID, vol)
+		// Record the real volume ID, not the instanceID placeholder, so
+		// later polls of GetServiceInstanceLastOperation hit the backend.
+		c.opMutex.Lock()
+		c.operations[opID].VolumeID = vol.GetId()
+		c.operations[opID].Ready = true
+		c.opMutex.Unlock()
+	}()
+
+	return &brokerapi.CreateServiceInstanceResponse{Operation: opID}, nil
+}
+
+// storeSnapshotInstance records the OpenSDS snapshot backing instanceID, and
+// the volume it was taken from, so Bind/RemoveServiceInstance can find them.
+func (c *openSDSController) storeSnapshotInstance(instanceID string, sourceVolumeID string, snap *model.VolumeSnapshotSpec) {
+	c.rwMutex.Lock()
+	defer c.rwMutex.Unlock()
+
+	c.instanceMap[instanceID] = &openSDSServiceInstance{
+		Name: instanceID,
+		Credential: &brokerapi.Credential{
+			"snapshotId":     snap.GetId(),
+			"sourceVolumeId": sourceVolumeID,
+		},
+	}
+}
+
+// createSnapshotInstance implements CreateServiceInstance for the
+// opensds-snapshot service: it takes a snapshot of req.Parameters's
+// sourceVolumeId.
+func (c *openSDSController) createSnapshotInstance(
+	instanceID string,
+	req *brokerapi.CreateServiceInstanceRequest,
+) (*brokerapi.CreateServiceInstanceResponse, error) {
+	sourceVolumeID, ok := req.Parameters["sourceVolumeId"].(string)
+	if !ok || sourceVolumeID == "" {
+		return nil, fmt.Errorf("sourceVolumeId parameter is required to create a snapshot")
+	}
+
+	createSnap := func() (*model.VolumeSnapshotSpec, error) {
+		return sdsController.GetClient(c.Endpoint).CreateVolumeSnapshot(&model.VolumeSnapshotSpec{
+			Name:     instanceID,
+			VolumeId: sourceVolumeID,
+		})
+	}
+
+	if !req.AcceptsIncomplete {
+		snap, err := createSnap()
+		if err != nil {
+			return nil, err
+		}
+		c.storeSnapshotInstance(instanceID, sourceVolumeID, snap)
+		return &brokerapi.CreateServiceInstanceResponse{}, nil
+	}
+
+	opID := c.startOperation(opProvision, instanceID)
+	go func() {
+		snap, err := createSnap()
+		if err != nil {
+			c.finishOperation(opID, stateFailed, err.Error())
+			return
+		}
+		c.storeSnapshotInstance(instanceID, sourceVolumeID, snap)
+		c.opMutex.Lock()
+		c.operations[opID].VolumeID = snap.GetId()
+		c.operations[opID].Ready = true
+		c.opMutex.Unlock()
+	}()
+
+	return &brokerapi.CreateServiceInstanceResponse{Operation: opID}, nil
 }
 
 func (c *openSDSController) RemoveServiceInstance(
@@ -127,24 +517,67 @@ func (c *openSDSController) RemoveServiceInstance(
 	acceptsIncomplete bool,
 ) (*brokerapi.DeleteServiceInstanceResponse, error) {
 	c.rwMutex.Lock()
-	defer c.rwMutex.Unlock()
-
 	instance, ok := c.instanceMap[instanceID]
+	c.rwMutex.Unlock()
 	if !ok {
 		return nil, fmt.Errorf("No such instance %s exited!", instanceID)
 	}
-	volInterface, ok := (*instance.Credential)["volumeId"]
+
+	removeInstance := func() {
+		c.rwMutex.Lock()
+		delete(c.instanceMap, instanceID)
+		c.rwMutex.Unlock()
+	}
+
+	if snapInterface, ok := c.credentialValue(instance, "snapshotId"); ok {
+		snapshotID := snapInterface.(string)
+
+		if !acceptsIncomplete {
+			if err := sdsController.GetClient(c.Endpoint).DeleteVolumeSnapshot(snapshotID, nil); err != nil {
+				return nil, err
+			}
+			removeInstance()
+			return &brokerapi.DeleteServiceInstanceResponse{}, nil
+		}
+
+		opID := c.startOperation(opDeprovision, snapshotID)
+		go func() {
+			if err := sdsController.GetClient(c.Endpoint).DeleteVolumeSnapshot(snapshotID, nil); err != nil {
+				c.finishOperation(opID, stateFailed, err.Error())
+				return
+			}
+			removeInstance()
+			c.finishOperation(opID, stateSucceeded, "snapshot deleted")
+		}()
+
+		return &brokerapi.DeleteServiceInstanceResponse{Operation: opID}, nil
+	}
+
+	volInterface, ok := c.credentialValue(instance, "volumeId")
 	if !ok {
 		return nil, fmt.Errorf("Volume id not provided in credential info!")
 	}
+	volumeID := volInterface.(string)
 
-	if err := sdsController.GetClient(c.Endpoint).
-		DeleteVolume(volInterface.(string), nil); err != nil {
-		return nil, err
+	if !acceptsIncomplete {
+		if err := sdsController.GetClient(c.Endpoint).DeleteVolume(volumeID, nil); err != nil {
+			return nil, err
+		}
+		removeInstance()
+		return &brokerapi.DeleteServiceInstanceResponse{}, nil
 	}
-	delete(c.instanceMap, instanceID)
 
-	return &brokerapi.DeleteServiceInstanceResponse{}, nil
+	opID := c.startOperation(opDeprovision, volumeID)
+	go func() {
+		if err := sdsController.GetClient(c.Endpoint).DeleteVolume(volumeID, nil); err != nil {
+			c.finishOperation(opID, stateFailed, err.Error())
+			return
+		}
+		removeInstance()
+		c.finishOperation(opID, stateSucceeded, "volume deleted")
+	}()
+
+	return &brokerapi.DeleteServiceInstanceResponse{Operation: opID}, nil
 }
 
 func (c *openSDSController) Bind(
@@ -152,13 +585,17 @@ func (c *openSDSController) Bind(
 	req *brokerapi.BindingRequest,
 ) (*brokerapi.CreateServiceBindingResponse, error) {
 	c.rwMutex.RLock()
-	defer c.rwMutex.RUnlock()
-
 	instance, ok := c.instanceMap[instanceID]
+	c.rwMutex.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("No such instance %s exited!", instanceID)
 	}
-	volInterface, ok := (*instance.Credential)["volumeId"]
+
+	if snapInterface, ok := c.credentialValue(instance, "snapshotId"); ok {
+		return c.bindClone(instance, snapInterface.(string), req)
+	}
+
+	volInterface, ok := c.credentialValue(instance, "volumeId")
 	if !ok {
 		return nil, fmt.Errorf("Volume id not provided in credential info!")
 	}
@@ -171,22 +608,106 @@ func (c *openSDSController) Bind(
 	if lvInterface, ok := req.Parameters["lvPath"]; ok {
 		in.Metadata["lvPath"] = lvInterface.(string)
 	}
-	atc, err := sdsController.GetClient(c.Endpoint).CreateVolumeAttachment(in)
-	if err != nil {
-		return nil, err
+
+	attach := func() (string, error) {
+		atc, err := sdsController.GetClient(c.Endpoint).CreateVolumeAttachment(in)
+		if err != nil {
+			return "", err
+		}
+		c.setCredential(instance, "attachmentId", atc.GetId())
+		c.setCredential(instance, "connectionInfo", atc.ConnectionInfo)
+		return atc.GetId(), nil
 	}
-	(*instance.Credential)["attachmentId"] = atc.GetId()
 
-	cred := instance.Credential
-	(*cred)["connectionInfo"] = atc.ConnectionInfo
-	return &brokerapi.CreateServiceBindingResponse{Credentials: *cred}, nil
+	if !req.AcceptsIncomplete {
+		if _, err := attach(); err != nil {
+			return nil, err
+		}
+		return &brokerapi.CreateServiceBindingResponse{Credentials: c.credentialSnapshot(instance)}, nil
+	}
+
+	opID := c.startOperation(opBind, in.VolumeId)
+	go func() {
+		atcID, err := attach()
+		if err != nil {
+			c.finishOperation(opID, stateFailed, err.Error())
+			return
+		}
+		c.opMutex.Lock()
+		c.operations[opID].VolumeID = atcID
+		c.operations[opID].Ready = true
+		c.opMutex.Unlock()
+	}()
+
+	return &brokerapi.CreateServiceBindingResponse{Operation: opID}, nil
+}
+
+// bindClone implements Bind for the opensds-snapshot service: it creates a
+// new volume cloned from snapshotID via CreateVolume's SnapshotId field, then
+// attaches that clone, so the binding's credentials point at a writable
+// copy of the snapshotted data.
+func (c *openSDSController) bindClone(
+	instance *openSDSServiceInstance,
+	snapshotID string,
+	req *brokerapi.BindingRequest,
+) (*brokerapi.CreateServiceBindingResponse, error) {
+	clone := func() (string, error) {
+		vol, err := sdsController.GetClient(c.Endpoint).CreateVolume(&model.VolumeSpec{
+			Name:       instance.Name + "-clone",
+			SnapshotId: snapshotID,
+		})
+		if err != nil {
+			return "", err
+		}
+		c.setCredential(instance, "cloneVolumeId", vol.GetId())
+
+		atc, err := sdsController.GetClient(c.Endpoint).CreateVolumeAttachment(&model.VolumeAttachmentSpec{
+			VolumeId: vol.GetId(),
+			HostInfo: &model.HostInfo{},
+		})
+		if err != nil {
+			return "", err
+		}
+		c.setCredential(instance, "attachmentId", atc.GetId())
+		c.setCredential(instance, "connectionInfo", atc.ConnectionInfo)
+		return atc.GetId(), nil
+	}
+
+	if !req.AcceptsIncomplete {
+		if _, err := clone(); err != nil {
+			return nil, err
+		}
+		return &brokerapi.CreateServiceBindingResponse{Credentials: c.credentialSnapshot(instance)}, nil
+	}
+
+	opID := c.startOperation(opBind, snapshotID)
+	go func() {
+		// Record the real attachment ID, not the snapshotID placeholder,
+		// mirroring Bind's async path, so GetServiceInstanceLastOperation
+		// can poll the attachment once it's ready.
+		atcID, err := clone()
+		if err != nil {
+			c.finishOperation(opID, stateFailed, err.Error())
+			return
+		}
+		c.opMutex.Lock()
+		c.operations[opID].VolumeID = atcID
+		c.operations[opID].Ready = true
+		c.opMutex.Unlock()
+	}()
+
+	return &brokerapi.CreateServiceBindingResponse{Operation: opID}, nil
 }
 
 func (c *openSDSController) UnBind(
 	instanceID, bindingID, serviceID, planID string,
 ) error {
-	c.rwMutex.RLock()
-	defer c.rwMutex.RUnlock()
+	// UnBind deletes from instance.Credential below, so it needs the
+	// exclusive lock for its whole duration, not just the instanceMap
+	// lookup: async Bind/bindClone goroutines write into that same map
+	// through the credential helpers, which also take c.rwMutex.
+	c.rwMutex.Lock()
+	defer c.rwMutex.Unlock()
 
 	instance, ok := c.instanceMap[instanceID]
 	if !ok {
@@ -201,7 +722,21 @@ func (c *openSDSController) UnBind(
 		DeleteVolumeAttachment(atcInterface.(string), nil); err != nil {
 		return err
 	}
+
+	// opensds-snapshot bindings clone a fresh volume each time; tear it
+	// down here, keeping the snapshotId so a later Bind can clone again.
+	if cloneInterface, ok := (*instance.Credential)["cloneVolumeId"]; ok {
+		if err := sdsController.GetClient(c.Endpoint).
+			DeleteVolume(cloneInterface.(string), nil); err != nil {
+			return err
+		}
+		delete(*instance.Credential, "cloneVolumeId")
+		delete(*instance.Credential, "attachmentId")
+		delete(*instance.Credential, "connectionInfo")
+		return nil
+	}
+
 	instance.Credential = &brokerapi.Credential{}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opensds/opensds/pkg/model"
+)
+
+func TestJsonSchemaType(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{name: "bool", in: true, want: "boolean"},
+		{name: "int", in: 42, want: "number"},
+		{name: "float", in: 3.14, want: "number"},
+		{name: "slice", in: []string{"a"}, want: "array"},
+		{name: "map", in: map[string]string{"a": "b"}, want: "object"},
+		{name: "string", in: "hello", want: "string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonSchemaType(tt.in); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaFromExtra(t *testing.T) {
+	extra := model.ExtraSpec{"thin": true, "diskType": "SSD"}
+
+	got := schemaFromExtra(extra)
+
+	want := map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-04/schema#",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"thin":     map[string]interface{}{"type": "boolean"},
+			"diskType": map[string]interface{}{"type": "string"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestTranslateStatus(t *testing.T) {
+	tests := []struct {
+		status    string
+		wantState operationState
+	}{
+		{"creating", stateInProgress},
+		{"deleting", stateInProgress},
+		{"attaching", stateInProgress},
+		{"detaching", stateInProgress},
+		{"available", stateSucceeded},
+		{"inUse", stateSucceeded},
+		{"error", stateFailed},
+		{"errorDeleting", stateFailed},
+		{"somethingUnknown", stateInProgress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			state, desc := translateStatus(tt.status)
+			if state != tt.wantState {
+				t.Errorf("status %q: got state %q, want %q", tt.status, state, tt.wantState)
+			}
+			if desc == "" {
+				t.Errorf("status %q: got empty description", tt.status)
+			}
+		})
+	}
+}